@@ -0,0 +1,142 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hetzner
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	config_util "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/discovery/targetgroup"
+)
+
+const (
+	hetznerHcloudLabelPrefix   = hetznerLabelPrefix + "hcloud_"
+	hetznerLabelHcloudImage    = hetznerHcloudLabelPrefix + "image_name"
+	hetznerLabelHcloudType     = hetznerHcloudLabelPrefix + "server_type"
+	hetznerLabelHcloudLabel    = hetznerHcloudLabelPrefix + "label_"
+	hetznerLabelHcloudCPUCores = hetznerHcloudLabelPrefix + "cpu_cores"
+
+	hcloudAPIEndpoint = "https://api.hetzner.cloud/v1"
+)
+
+// hcloudDiscovery performs Hetzner Cloud API requests. NewDiscovery wraps
+// its refresh method in a refresh.Discovery, which runs it periodically.
+type hcloudDiscovery struct {
+	logger    log.Logger
+	client    *http.Client
+	port      int
+	endpoint  string
+	labelsDir string
+}
+
+// newHcloudDiscovery returns a new hcloudDiscovery which periodically refreshes its targets.
+func newHcloudDiscovery(conf *SDConfig, logger log.Logger) (*hcloudDiscovery, error) {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	d := &hcloudDiscovery{
+		logger:    logger,
+		port:      conf.Port,
+		endpoint:  hcloudAPIEndpoint,
+		labelsDir: conf.LabelsDir,
+	}
+
+	rt, err := config_util.NewRoundTripperFromConfig(conf.HTTPClientConfig, "hetzner_sd", false, false)
+	if err != nil {
+		return nil, err
+	}
+	d.client = &http.Client{
+		Transport: rt,
+		Timeout:   time.Duration(conf.RefreshInterval),
+	}
+
+	return d, nil
+}
+
+func (d *hcloudDiscovery) refresh(ctx context.Context) ([]*targetgroup.Group, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.endpoint+"/servers", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	var servers hcloudServersList
+	if err := json.NewDecoder(resp.Body).Decode(&servers); err != nil {
+		return nil, err
+	}
+
+	targets := make([]model.LabelSet, len(servers.Servers))
+	for i, server := range servers.Servers {
+		labels := model.LabelSet{
+			hetznerLabelRole:           model.LabelValue(hetznerRoleHcloud),
+			hetznerLabelServerID:       model.LabelValue(strconv.Itoa(server.ID)),
+			hetznerLabelServerName:     model.LabelValue(server.Name),
+			hetznerLabelDatacenter:     model.LabelValue(server.Datacenter.Name),
+			hetznerLabelServerStatus:   model.LabelValue(server.Status),
+			hetznerLabelPublicIPv4:     model.LabelValue(server.PublicNet.IPv4.IP),
+			hetznerLabelHcloudImage:    model.LabelValue(server.Image.Name),
+			hetznerLabelHcloudType:     model.LabelValue(server.ServerType.Name),
+			hetznerLabelHcloudCPUCores: model.LabelValue(strconv.Itoa(server.ServerType.Cores)),
+
+			model.AddressLabel: model.LabelValue(net.JoinHostPort(server.PublicNet.IPv4.IP, strconv.FormatUint(uint64(d.port), 10))),
+		}
+		for name, value := range server.Labels {
+			labels[model.LabelName(hetznerLabelHcloudLabel+name)] = model.LabelValue(value)
+		}
+		applyLocalLabels(d.logger, d.labelsDir, strconv.Itoa(server.ID), labels)
+		targets[i] = labels
+	}
+	return []*targetgroup.Group{{Source: "hetzner", Targets: targets}}, nil
+}
+
+type hcloudServersList struct {
+	Servers []struct {
+		ID        int               `json:"id"`
+		Name      string            `json:"name"`
+		Status    string            `json:"status"`
+		Labels    map[string]string `json:"labels"`
+		PublicNet struct {
+			IPv4 struct {
+				IP string `json:"ip"`
+			} `json:"ipv4"`
+		} `json:"public_net"`
+		Datacenter struct {
+			Name string `json:"name"`
+		} `json:"datacenter"`
+		ServerType struct {
+			Name  string `json:"name"`
+			Cores int    `json:"cores"`
+		} `json:"server_type"`
+		Image struct {
+			Name string `json:"name"`
+		} `json:"image"`
+	} `json:"servers"`
+}
@@ -0,0 +1,208 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hetzner
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	config_util "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+
+	"github.com/prometheus/prometheus/discovery"
+	"github.com/prometheus/prometheus/discovery/refresh"
+	"github.com/prometheus/prometheus/discovery/targetgroup"
+)
+
+const (
+	// hetznerLabelPrefix is the prefix for all meta labels in this discovery.
+	hetznerLabelPrefix = model.MetaLabelPrefix + "hetzner_"
+
+	hetznerLabelRole       = hetznerLabelPrefix + "role"
+	hetznerLabelServerID   = hetznerLabelPrefix + "server_id"
+	hetznerLabelServerName = hetznerLabelPrefix + "server_name"
+	hetznerLabelDatacenter = hetznerLabelPrefix + "datacenter"
+
+	hetznerLabelPublicIPv4        = hetznerLabelPrefix + "public_ipv4"
+	hetznerLabelPublicIPv6Network = hetznerLabelPrefix + "public_ipv6_network"
+	hetznerLabelServerStatus      = hetznerLabelPrefix + "server_status"
+
+	// hetznerLocalLabelPrefix is used for labels sourced from the optional
+	// LabelsDir overlay rather than the Hetzner API itself.
+	hetznerLocalLabelPrefix = hetznerLabelPrefix + "local_"
+
+	hetznerRoleHcloud = "hcloud"
+	hetznerRoleRobot  = "robot"
+
+	robotEndpoint = "https://robot-ws.your-server.de"
+)
+
+// DefaultSDConfig is the default Hetzner SD configuration.
+var DefaultSDConfig = SDConfig{
+	RefreshInterval:     model.Duration(60 * time.Second),
+	HTTPClientConfig:    config_util.DefaultHTTPClientConfig,
+	Port:                80,
+	RobotAuxConcurrency: 5,
+	RobotAuxCacheTTL:    model.Duration(5 * time.Minute),
+}
+
+// SDConfig is the configuration for Hetzner Cloud and Robot based service discovery.
+type SDConfig struct {
+	HTTPClientConfig config_util.HTTPClientConfig `yaml:",inline"`
+	RefreshInterval  model.Duration               `yaml:"refresh_interval,omitempty"`
+	Port             int                          `yaml:"port"`
+	Role             string                       `yaml:"role"`
+
+	// RobotAuxConcurrency bounds, for each account, the number of servers
+	// whose auxiliary Robot API calls (reset/rescue/traffic) are in flight
+	// at once. Accounts are refreshed in parallel, each with its own limit.
+	RobotAuxConcurrency int `yaml:"robot_aux_concurrency,omitempty"`
+	// RobotAuxCacheTTL controls how long the results of those auxiliary
+	// calls are reused across refreshes before being re-fetched. A zero
+	// TTL never expires cached results.
+	RobotAuxCacheTTL model.Duration `yaml:"robot_aux_cache_ttl,omitempty"`
+
+	// LabelsDir, if set, is consulted after building each target: for a
+	// discovered server with id "42" it reads every file in
+	// "<LabelsDir>/42/" and merges them into the target's labels, using
+	// the filename as the label name (prefixed with
+	// hetznerLocalLabelPrefix) and the trimmed file contents as the
+	// value. This lets operators attach metadata Hetzner itself doesn't
+	// store without editing relabel rules per machine.
+	LabelsDir string `yaml:"label_files_dir,omitempty"`
+
+	// Accounts, for the robot role, lists the credentialed Robot accounts
+	// to discover servers from. refresh fans out to every account
+	// concurrently and merges the results into a single target group,
+	// deduplicated by server number. If empty, the top-level
+	// HTTPClientConfig is used as a single unnamed account, preserving
+	// the single-account behaviour.
+	Accounts []RobotAccount `yaml:"accounts,omitempty"`
+
+	robotEndpoint string
+}
+
+// Name returns the name of the Config.
+func (*SDConfig) Name() string { return "hetzner" }
+
+// NewDiscoverer returns a Discoverer for the Config.
+func (c *SDConfig) NewDiscoverer(opts discovery.DiscovererOptions) (discovery.Discoverer, error) {
+	return NewDiscovery(c, opts.Logger)
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (c *SDConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultSDConfig
+	type plain SDConfig
+	err := unmarshal((*plain)(c))
+	if err != nil {
+		return err
+	}
+	switch c.Role {
+	case hetznerRoleHcloud:
+		// Hetzner Cloud only accepts a bearer token, never basic auth.
+		if c.HTTPClientConfig.BasicAuth != nil {
+			return errors.New("hetzner SD configuration requires a bearer token for the hcloud role, not basic auth")
+		}
+		if c.HTTPClientConfig.Authorization == nil && c.HTTPClientConfig.BearerToken == "" && c.HTTPClientConfig.BearerTokenFile == "" {
+			return errors.New("hetzner SD configuration requires a bearer token for the hcloud role")
+		}
+	case hetznerRoleRobot:
+		c.robotEndpoint = robotEndpoint
+		if len(c.Accounts) == 0 && c.HTTPClientConfig.BasicAuth == nil {
+			return errors.New("hetzner SD configuration requires a username and password, or at least one account")
+		}
+		for _, account := range c.Accounts {
+			if err := account.HTTPClientConfig.Validate(); err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.New("unknown role: " + c.Role)
+	}
+	return c.HTTPClientConfig.Validate()
+}
+
+// NewDiscovery returns a new combined Discoverer for Hetzner Cloud and Robot.
+func NewDiscovery(conf *SDConfig, logger log.Logger) (*refresh.Discovery, error) {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	var (
+		refreshFn func(ctx context.Context) ([]*targetgroup.Group, error)
+		err       error
+	)
+	switch conf.Role {
+	case hetznerRoleHcloud:
+		var disc *hcloudDiscovery
+		disc, err = newHcloudDiscovery(conf, logger)
+		refreshFn = disc.refresh
+	case hetznerRoleRobot:
+		var disc *robotDiscovery
+		disc, err = newRobotDiscovery(conf, logger)
+		refreshFn = disc.refresh
+	default:
+		return nil, errors.New("unknown role: " + conf.Role)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return refresh.NewDiscovery(
+		logger,
+		"hetzner",
+		time.Duration(conf.RefreshInterval),
+		refreshFn,
+	), nil
+}
+
+// applyLocalLabels merges any opt-in local label overlay files found under
+// <labelsDir>/<serverID>/ into labels, using the filename as the label name
+// (prefixed with hetznerLocalLabelPrefix) and the trimmed file contents as
+// the value. It is a no-op if labelsDir is empty or the directory does not
+// exist for this server. Filenames that wouldn't form a valid Prometheus
+// label name are skipped and logged, rather than silently producing a label
+// relabeling will later drop.
+func applyLocalLabels(logger log.Logger, labelsDir, serverID string, labels model.LabelSet) {
+	if labelsDir == "" {
+		return
+	}
+	dir := filepath.Join(labelsDir, serverID)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := model.LabelName(hetznerLocalLabelPrefix + entry.Name())
+		if !name.IsValid() {
+			level.Warn(logger).Log("msg", "skipping local label file with invalid label name", "server_id", serverID, "file", entry.Name())
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		labels[name] = model.LabelValue(strings.TrimSpace(string(content)))
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package httpsd re-exports Hetzner Robot/Cloud discovery results as an
+// http_sd_config-compatible endpoint. It is meant for environments where
+// Prometheus itself must not hold Hetzner credentials: a small sidecar runs
+// this handler instead, and Prometheus points an http_sd_config at it.
+package httpsd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/common/model"
+
+	"github.com/prometheus/prometheus/discovery"
+	"github.com/prometheus/prometheus/discovery/hetzner"
+	"github.com/prometheus/prometheus/discovery/targetgroup"
+)
+
+// httpSDTarget mirrors the JSON shape expected by Prometheus' http_sd_config.
+type httpSDTarget struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+// Handler serves the most recent Hetzner discovery results in the
+// http_sd_config JSON format. It reuses the same refresh cache as the
+// in-process Discoverer: results are only as fresh as the wrapped
+// SDConfig's RefreshInterval, not re-fetched on every HTTP request.
+type Handler struct {
+	logger log.Logger
+
+	mtx     sync.RWMutex
+	payload []byte
+	etag    string
+}
+
+// NewHandler starts discovery for conf in the background and returns a
+// Handler once the first refresh has completed (or ctx is done first). The
+// returned Handler keeps running until ctx is cancelled; mount it at
+// whatever path the caller's http_sd_config should poll, e.g.
+// mux.Handle("/hetzner/targets", h).
+func NewHandler(ctx context.Context, conf *hetzner.SDConfig, logger log.Logger) (*Handler, error) {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	disc, err := conf.NewDiscoverer(discovery.DiscovererOptions{Logger: logger})
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(chan []*targetgroup.Group)
+	go disc.Run(ctx, updates)
+
+	return newHandlerFromUpdates(ctx, updates, logger)
+}
+
+// newHandlerFromUpdates does the actual work behind NewHandler, taking the
+// discovery update channel directly so it can be exercised in tests without
+// a real Discoverer.
+func newHandlerFromUpdates(ctx context.Context, updates <-chan []*targetgroup.Group, logger log.Logger) (*Handler, error) {
+	h := &Handler{logger: logger}
+
+	ready := make(chan struct{})
+	var closeReady sync.Once
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case groups, ok := <-updates:
+				if !ok {
+					return
+				}
+				h.set(groups)
+				closeReady.Do(func() { close(ready) })
+			}
+		}
+	}()
+
+	select {
+	case <-ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return h, nil
+}
+
+// set recomputes the cached JSON payload and ETag for groups.
+func (h *Handler) set(groups []*targetgroup.Group) {
+	targets := []httpSDTarget{}
+	for _, g := range groups {
+		for _, lbls := range g.Targets {
+			var address string
+			labels := make(map[string]string, len(lbls)+len(g.Labels))
+			for name, value := range g.Labels {
+				labels[string(name)] = string(value)
+			}
+			for name, value := range lbls {
+				if name == model.AddressLabel {
+					address = string(value)
+					continue
+				}
+				labels[string(name)] = string(value)
+			}
+			targets = append(targets, httpSDTarget{Targets: []string{address}, Labels: labels})
+		}
+	}
+
+	payload, err := json.Marshal(targets)
+	if err != nil {
+		level.Error(h.logger).Log("msg", "failed to marshal hetzner http_sd payload", "err", err)
+		return
+	}
+
+	sum := sha256.Sum256(payload)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+	h.mtx.Lock()
+	h.payload = payload
+	h.etag = etag
+	h.mtx.Unlock()
+}
+
+// ServeHTTP implements http.Handler, serving the cached payload and
+// supporting If-None-Match for cheap polling.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mtx.RLock()
+	payload, etag := h.payload, h.etag
+	h.mtx.RUnlock()
+
+	if payload == nil {
+		http.Error(w, "hetzner discovery not ready", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	if match := r.Header.Get("If-None-Match"); match != "" && match == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(payload)
+}
@@ -0,0 +1,128 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpsd
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/common/model"
+
+	"github.com/prometheus/prometheus/discovery/targetgroup"
+)
+
+func TestHandlerServeHTTPNotReady(t *testing.T) {
+	h := &Handler{logger: log.NewNopLogger()}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != 503 {
+		t.Errorf("status = %d, want 503 before first refresh", w.Code)
+	}
+}
+
+func TestHandlerServeHTTPETagAndIfNoneMatch(t *testing.T) {
+	h := &Handler{logger: log.NewNopLogger()}
+	h.set([]*targetgroup.Group{{
+		Targets: []model.LabelSet{{model.AddressLabel: "10.0.0.1:80"}},
+	}})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != 200 {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("ETag header not set")
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != 304 {
+		t.Errorf("status = %d, want 304 for matching If-None-Match", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-None-Match", `"stale"`)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Errorf("status = %d, want 200 for stale If-None-Match", w.Code)
+	}
+}
+
+func TestHandlerServeHTTPEmptyTargetsIsEmptyArray(t *testing.T) {
+	h := &Handler{logger: log.NewNopLogger()}
+	h.set(nil)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if got, want := w.Body.String(), "[]"; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+}
+
+func TestNewHandlerFromUpdatesWaitsForFirstRefresh(t *testing.T) {
+	updates := make(chan []*targetgroup.Group)
+
+	var h *Handler
+	var err error
+	done := make(chan struct{})
+	go func() {
+		h, err = newHandlerFromUpdates(context.Background(), updates, log.NewNopLogger())
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("newHandlerFromUpdates returned before any update was sent")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	updates <- []*targetgroup.Group{{Targets: []model.LabelSet{{model.AddressLabel: "10.0.0.1:80"}}}}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("newHandlerFromUpdates did not return after an update was sent")
+	}
+
+	if err != nil {
+		t.Fatalf("newHandlerFromUpdates returned error: %v", err)
+	}
+	if h.payload == nil {
+		t.Error("handler payload was not set from the first update")
+	}
+}
+
+func TestNewHandlerFromUpdatesReturnsErrorOnContextDone(t *testing.T) {
+	updates := make(chan []*targetgroup.Group)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := newHandlerFromUpdates(ctx, updates, log.NewNopLogger())
+	if err == nil {
+		t.Fatal("newHandlerFromUpdates returned no error for an already-cancelled context")
+	}
+}
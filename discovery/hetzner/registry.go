@@ -0,0 +1,136 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hetzner
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/common/model"
+
+	"github.com/prometheus/prometheus/discovery"
+	"github.com/prometheus/prometheus/discovery/targetgroup"
+)
+
+// Registry keeps the most recently discovered Hetzner targets in memory and
+// answers label-selector queries against them, without re-querying the
+// Hetzner API or scraping Prometheus. It can be embedded by other tools, or
+// driven from an http.Handler that calls Resolve per request. Useful for
+// ad-hoc ops scripts, e.g. "give me all cancelled EX42 servers in HEL1".
+type Registry struct {
+	logger log.Logger
+
+	mtx     sync.RWMutex
+	targets []model.LabelSet
+}
+
+// NewRegistry starts discovery for conf in the background and returns a
+// Registry that keeps its most recent results in memory until ctx is
+// cancelled.
+func NewRegistry(ctx context.Context, conf *SDConfig, logger log.Logger) (*Registry, error) {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	disc, err := conf.NewDiscoverer(discovery.DiscovererOptions{Logger: logger})
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Registry{logger: logger}
+
+	updates := make(chan []*targetgroup.Group)
+	go disc.Run(ctx, updates)
+	go r.consume(ctx, updates)
+
+	return r, nil
+}
+
+func (r *Registry) consume(ctx context.Context, updates <-chan []*targetgroup.Group) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case groups, ok := <-updates:
+			if !ok {
+				return
+			}
+			r.set(groups)
+		}
+	}
+}
+
+func (r *Registry) set(groups []*targetgroup.Group) {
+	var targets []model.LabelSet
+	for _, g := range groups {
+		for _, lbls := range g.Targets {
+			merged := make(model.LabelSet, len(lbls)+len(g.Labels))
+			for name, value := range g.Labels {
+				merged[name] = value
+			}
+			for name, value := range lbls {
+				merged[name] = value
+			}
+			targets = append(targets, merged)
+		}
+	}
+
+	r.mtx.Lock()
+	r.targets = targets
+	r.mtx.Unlock()
+}
+
+// selectorAliases maps short, commonly used selector keys to the Hetzner
+// meta label suffix they stand for, so callers can write the terse form
+// operators actually use at the shell (e.g. `dc=fsn1-dc14`) instead of the
+// full label name.
+var selectorAliases = map[string]string{
+	"dc": "datacenter",
+}
+
+// Resolve returns the addresses (host:port, as produced by the discovery's
+// address label) of every target matching selector. A selector key is
+// interpreted as a Hetzner meta label with the "__meta_hetzner_" prefix
+// added back (so `role` matches hetznerLabelRole, `robot_product` matches
+// hetznerLabelRobotProduct), after resolving any selectorAliases (so `dc`
+// matches hetznerLabelDatacenter), unless the key already carries a
+// "__meta_" prefix, in which case it is used verbatim. A target must match
+// every key/value pair in selector to be included.
+func (r *Registry) Resolve(selector map[string]string) []string {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	var matches []string
+targets:
+	for _, labels := range r.targets {
+		for key, value := range selector {
+			name := model.LabelName(key)
+			if !strings.HasPrefix(key, string(model.MetaLabelPrefix)) {
+				if alias, ok := selectorAliases[key]; ok {
+					key = alias
+				}
+				name = model.LabelName(hetznerLabelPrefix + key)
+			}
+			if string(labels[name]) != value {
+				continue targets
+			}
+		}
+		if addr, ok := labels[model.AddressLabel]; ok {
+			matches = append(matches, string(addr))
+		}
+	}
+	return matches
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hetzner
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/discovery/targetgroup"
+)
+
+func testRegistry() *Registry {
+	r := &Registry{}
+	r.set([]*targetgroup.Group{
+		{
+			Targets: []model.LabelSet{
+				{
+					model.AddressLabel:         "10.0.0.1:80",
+					hetznerLabelRole:           model.LabelValue(hetznerRoleRobot),
+					hetznerLabelDatacenter:     "fsn1-dc14",
+					hetznerLabelRobotCancelled: "true",
+				},
+				{
+					model.AddressLabel:         "10.0.0.2:80",
+					hetznerLabelRole:           model.LabelValue(hetznerRoleRobot),
+					hetznerLabelDatacenter:     "hel1-dc2",
+					hetznerLabelRobotCancelled: "false",
+				},
+				{
+					model.AddressLabel: "10.0.0.3:80",
+					hetznerLabelRole:   model.LabelValue(hetznerRoleHcloud),
+				},
+			},
+		},
+	})
+	return r
+}
+
+func TestRegistryResolveMatch(t *testing.T) {
+	r := testRegistry()
+
+	got := r.Resolve(map[string]string{"dc": "fsn1-dc14"})
+	want := []string{"10.0.0.1:80"}
+	if len(got) != len(want) || got[0] != want[0] {
+		t.Errorf("Resolve(dc=fsn1-dc14) = %v, want %v", got, want)
+	}
+}
+
+func TestRegistryResolveMultiKeyMatch(t *testing.T) {
+	r := testRegistry()
+
+	got := r.Resolve(map[string]string{"role": string(hetznerRoleRobot), "robot_cancelled": "true"})
+	want := []string{"10.0.0.1:80"}
+	if len(got) != len(want) || got[0] != want[0] {
+		t.Errorf("Resolve(role=robot, robot_cancelled=true) = %v, want %v", got, want)
+	}
+}
+
+func TestRegistryResolveNoMatch(t *testing.T) {
+	r := testRegistry()
+
+	got := r.Resolve(map[string]string{"dc": "does-not-exist"})
+	if len(got) != 0 {
+		t.Errorf("Resolve(dc=does-not-exist) = %v, want empty", got)
+	}
+}
+
+func TestRegistryResolveEmptySelector(t *testing.T) {
+	r := testRegistry()
+
+	got := r.Resolve(map[string]string{})
+	sort.Strings(got)
+	want := []string{"10.0.0.1:80", "10.0.0.2:80", "10.0.0.3:80"}
+	if len(got) != len(want) {
+		t.Fatalf("Resolve({}) = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Resolve({}) = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestRegistryResolveFullyQualifiedKey(t *testing.T) {
+	r := testRegistry()
+
+	got := r.Resolve(map[string]string{string(hetznerLabelDatacenter): "hel1-dc2"})
+	want := []string{"10.0.0.2:80"}
+	if len(got) != len(want) || got[0] != want[0] {
+		t.Errorf("Resolve(%s=hel1-dc2) = %v, want %v", hetznerLabelDatacenter, got, want)
+	}
+}
@@ -23,9 +23,11 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
 	config_util "github.com/prometheus/common/config"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/discovery/refresh"
@@ -36,37 +38,161 @@ const (
 	hetznerRobotLabelPrefix    = hetznerLabelPrefix + "robot_"
 	hetznerLabelRobotProduct   = hetznerRobotLabelPrefix + "product"
 	hetznerLabelRobotCancelled = hetznerRobotLabelPrefix + "cancelled"
+	hetznerLabelRobotRescue    = hetznerRobotLabelPrefix + "rescue_active"
+	hetznerLabelRobotResetType = hetznerRobotLabelPrefix + "reset_type"
+	hetznerLabelRobotTraffic   = hetznerRobotLabelPrefix + "traffic_current"
+	hetznerLabelRobotAccount   = hetznerRobotLabelPrefix + "account"
+
+	// defaultRobotAuxConcurrency is used when the SDConfig was built
+	// without going through UnmarshalYAML (e.g. constructed in Go code).
+	defaultRobotAuxConcurrency = 5
 )
 
+// RobotAccount is a single credentialed Hetzner Robot account to discover
+// servers from. Name is purely cosmetic: it is attached to every target
+// found under this account as hetznerLabelRobotAccount so that targets
+// from different accounts can be told apart and relabeled independently.
+type RobotAccount struct {
+	Name             string                       `yaml:"name,omitempty"`
+	HTTPClientConfig config_util.HTTPClientConfig `yaml:",inline"`
+}
+
+// robotAccountClient is a RobotAccount resolved to a ready-to-use HTTP client.
+type robotAccountClient struct {
+	name   string
+	client *http.Client
+}
+
 // Discovery periodically performs Hetzner Robot requests. It implements
 // the Discoverer interface.
 type robotDiscovery struct {
 	*refresh.Discovery
-	client   *http.Client
-	port     int
-	endpoint string
+	logger         log.Logger
+	accounts       []robotAccountClient
+	port           int
+	endpoint       string
+	labelsDir      string
+	auxConcurrency int
+	auxCacheTTL    time.Duration
+
+	auxMtx   sync.Mutex
+	auxCache map[int]robotAuxCacheEntry
+}
+
+// robotAuxCacheEntry holds the result of the auxiliary rescue/reset/traffic
+// calls for a single server, along with the time it was fetched.
+type robotAuxCacheEntry struct {
+	fetchedAt time.Time
+	info      robotAuxInfo
+}
+
+// robotAuxInfo is the enrichment data fetched per server from the
+// reset/rescue/traffic Robot API endpoints.
+type robotAuxInfo struct {
+	rescueActive   bool
+	resetType      string
+	trafficCurrent string
 }
 
 // newRobotDiscovery returns a new robotDiscovery which periodically refreshes its targets.
 func newRobotDiscovery(conf *SDConfig, logger log.Logger) (*robotDiscovery, error) {
-	d := &robotDiscovery{
-		port:     conf.Port,
-		endpoint: conf.robotEndpoint,
+	if logger == nil {
+		logger = log.NewNopLogger()
 	}
 
-	rt, err := config_util.NewRoundTripperFromConfig(conf.HTTPClientConfig, "hetzner_sd", false, false)
-	if err != nil {
-		return nil, err
+	auxConcurrency := conf.RobotAuxConcurrency
+	if auxConcurrency <= 0 {
+		auxConcurrency = defaultRobotAuxConcurrency
+	}
+
+	accountConfigs := conf.Accounts
+	if len(accountConfigs) == 0 {
+		accountConfigs = []RobotAccount{{HTTPClientConfig: conf.HTTPClientConfig}}
 	}
-	d.client = &http.Client{
-		Transport: rt,
-		Timeout:   time.Duration(conf.RefreshInterval),
+
+	accounts := make([]robotAccountClient, 0, len(accountConfigs))
+	for _, account := range accountConfigs {
+		rt, err := config_util.NewRoundTripperFromConfig(account.HTTPClientConfig, "hetzner_sd", false, false)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, robotAccountClient{
+			name: account.Name,
+			client: &http.Client{
+				Transport: rt,
+				Timeout:   time.Duration(conf.RefreshInterval),
+			},
+		})
+	}
+
+	d := &robotDiscovery{
+		logger:         logger,
+		accounts:       accounts,
+		port:           conf.Port,
+		endpoint:       conf.robotEndpoint,
+		labelsDir:      conf.LabelsDir,
+		auxConcurrency: auxConcurrency,
+		auxCacheTTL:    time.Duration(conf.RobotAuxCacheTTL),
+		auxCache:       make(map[int]robotAuxCacheEntry),
 	}
 
 	return d, nil
 }
+
 func (d *robotDiscovery) refresh(ctx context.Context) ([]*targetgroup.Group, error) {
-	resp, err := d.client.Get(d.endpoint + "/server")
+	var (
+		wg       sync.WaitGroup
+		mtx      sync.Mutex
+		merged   = make(map[int]model.LabelSet)
+		firstErr error
+	)
+
+	for _, account := range d.accounts {
+		wg.Add(1)
+		go func(account robotAccountClient) {
+			defer wg.Done()
+
+			labelSets, err := d.refreshAccount(ctx, account)
+			if err != nil {
+				level.Error(d.logger).Log("msg", "failed to refresh hetzner robot account", "account", account.name, "err", err)
+				mtx.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mtx.Unlock()
+				return
+			}
+
+			mtx.Lock()
+			for serverNumber, labels := range labelSets {
+				if _, ok := merged[serverNumber]; !ok {
+					merged[serverNumber] = labels
+				}
+			}
+			mtx.Unlock()
+		}(account)
+	}
+	wg.Wait()
+
+	if firstErr != nil && len(merged) == 0 {
+		return nil, firstErr
+	}
+
+	targets := make([]model.LabelSet, 0, len(merged))
+	for _, labels := range merged {
+		targets = append(targets, labels)
+	}
+	return []*targetgroup.Group{{Source: "hetzner", Targets: targets}}, nil
+}
+
+// refreshAccount fetches the server list for a single account and returns
+// its targets' LabelSets keyed by server number.
+func (d *robotDiscovery) refreshAccount(ctx context.Context, account robotAccountClient) (map[int]model.LabelSet, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.endpoint+"/server", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := account.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -75,13 +201,14 @@ func (d *robotDiscovery) refresh(ctx context.Context) ([]*targetgroup.Group, err
 		resp.Body.Close()
 	}()
 	var servers serversList
-	err = json.NewDecoder(resp.Body).Decode(&servers)
-	if err != nil {
+	if err := json.NewDecoder(resp.Body).Decode(&servers); err != nil {
 		return nil, err
 	}
 
-	targets := make([]model.LabelSet, len(servers))
-	for i, server := range servers {
+	auxInfo := d.fetchAuxInfo(ctx, account, servers)
+
+	result := make(map[int]model.LabelSet, len(servers))
+	for _, server := range servers {
 		labels := model.LabelSet{
 			hetznerLabelRole:           model.LabelValue(hetznerRoleRobot),
 			hetznerLabelServerID:       model.LabelValue(strconv.Itoa(server.Server.ServerNumber)),
@@ -91,6 +218,7 @@ func (d *robotDiscovery) refresh(ctx context.Context) ([]*targetgroup.Group, err
 			hetznerLabelServerStatus:   model.LabelValue(server.Server.Status),
 			hetznerLabelRobotProduct:   model.LabelValue(server.Server.Product),
 			hetznerLabelRobotCancelled: model.LabelValue(fmt.Sprintf("%t", server.Server.Canceled)),
+			hetznerLabelRobotAccount:   model.LabelValue(account.name),
 
 			model.AddressLabel: model.LabelValue(net.JoinHostPort(server.Server.ServerIP, strconv.FormatUint(uint64(d.port), 10))),
 		}
@@ -102,9 +230,128 @@ func (d *robotDiscovery) refresh(ctx context.Context) ([]*targetgroup.Group, err
 			}
 
 		}
-		targets[i] = labels
+		if info, ok := auxInfo[server.Server.ServerNumber]; ok {
+			labels[hetznerLabelRobotRescue] = model.LabelValue(fmt.Sprintf("%t", info.rescueActive))
+			labels[hetznerLabelRobotResetType] = model.LabelValue(info.resetType)
+			labels[hetznerLabelRobotTraffic] = model.LabelValue(info.trafficCurrent)
+		}
+		applyLocalLabels(d.logger, d.labelsDir, strconv.Itoa(server.Server.ServerNumber), labels)
+		result[server.Server.ServerNumber] = labels
 	}
-	return []*targetgroup.Group{{Source: "hetzner", Targets: targets}}, nil
+	return result, nil
+}
+
+// fetchAuxInfo enriches servers with their rescue/reset/traffic state by
+// querying the corresponding Robot API endpoints for the given account.
+// Calls are bounded by auxConcurrency and results are cached for
+// auxCacheTTL to avoid hammering the API on every refresh.
+func (d *robotDiscovery) fetchAuxInfo(ctx context.Context, account robotAccountClient, servers serversList) map[int]robotAuxInfo {
+	result := make(map[int]robotAuxInfo, len(servers))
+
+	sem := make(chan struct{}, d.auxConcurrency)
+	var wg sync.WaitGroup
+	var mtx sync.Mutex
+
+	for _, server := range servers {
+		serverNumber := server.Server.ServerNumber
+
+		if info, ok := d.cachedAuxInfo(serverNumber); ok {
+			mtx.Lock()
+			result[serverNumber] = info
+			mtx.Unlock()
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(serverNumber int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			info := d.fetchServerAuxInfo(ctx, account.client, serverNumber)
+
+			d.auxMtx.Lock()
+			d.auxCache[serverNumber] = robotAuxCacheEntry{fetchedAt: time.Now(), info: info}
+			d.auxMtx.Unlock()
+
+			mtx.Lock()
+			result[serverNumber] = info
+			mtx.Unlock()
+		}(serverNumber)
+	}
+	wg.Wait()
+
+	return result
+}
+
+// cachedAuxInfo returns the cached aux info for serverNumber if it is still
+// within auxCacheTTL. A zero auxCacheTTL never expires entries.
+func (d *robotDiscovery) cachedAuxInfo(serverNumber int) (robotAuxInfo, bool) {
+	d.auxMtx.Lock()
+	defer d.auxMtx.Unlock()
+
+	entry, ok := d.auxCache[serverNumber]
+	if !ok || (d.auxCacheTTL > 0 && time.Since(entry.fetchedAt) > d.auxCacheTTL) {
+		return robotAuxInfo{}, false
+	}
+	return entry.info, true
+}
+
+// fetchServerAuxInfo queries the reset/rescue/traffic endpoints for a single
+// server using the given account's client. Errors are swallowed (leaving
+// the corresponding fields zero) so a single misbehaving auxiliary call
+// does not fail the whole refresh.
+func (d *robotDiscovery) fetchServerAuxInfo(ctx context.Context, client *http.Client, serverNumber int) robotAuxInfo {
+	var info robotAuxInfo
+
+	var reset struct {
+		Reset struct {
+			Type []string `json:"type"`
+		} `json:"reset"`
+	}
+	if d.getJSON(ctx, client, fmt.Sprintf("/reset/%d", serverNumber), &reset) == nil && len(reset.Reset.Type) > 0 {
+		info.resetType = reset.Reset.Type[0]
+	}
+
+	var rescue struct {
+		Boot struct {
+			Rescue struct {
+				Active bool `json:"active"`
+			} `json:"rescue"`
+		} `json:"boot"`
+	}
+	if d.getJSON(ctx, client, fmt.Sprintf("/boot/%d/rescue", serverNumber), &rescue) == nil {
+		info.rescueActive = rescue.Boot.Rescue.Active
+	}
+
+	var traffic struct {
+		Traffic struct {
+			Current string `json:"traffic_current"`
+		} `json:"traffic"`
+	}
+	if d.getJSON(ctx, client, fmt.Sprintf("/traffic/%d", serverNumber), &traffic) == nil {
+		info.trafficCurrent = traffic.Traffic.Current
+	}
+
+	return info
+}
+
+// getJSON performs a GET request against the Robot API and decodes the JSON
+// response body into v.
+func (d *robotDiscovery) getJSON(ctx context.Context, client *http.Client, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.endpoint+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+	return json.NewDecoder(resp.Body).Decode(v)
 }
 
 type serversList []struct {
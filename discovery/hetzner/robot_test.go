@@ -0,0 +1,181 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hetzner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+// roundTripFunc lets a test stand in a fake transport without touching the
+// network.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func jsonResponse(body string) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+		Header:     make(http.Header),
+	}
+}
+
+func TestRobotDiscoveryCachedAuxInfoRespectsTTL(t *testing.T) {
+	d := &robotDiscovery{
+		auxCacheTTL: time.Minute,
+		auxCache:    make(map[int]robotAuxCacheEntry),
+	}
+
+	d.auxCache[1] = robotAuxCacheEntry{fetchedAt: time.Now(), info: robotAuxInfo{resetType: "hw"}}
+	d.auxCache[2] = robotAuxCacheEntry{fetchedAt: time.Now().Add(-2 * time.Minute), info: robotAuxInfo{resetType: "sw"}}
+
+	if info, ok := d.cachedAuxInfo(1); !ok || info.resetType != "hw" {
+		t.Errorf("cachedAuxInfo(1) = %+v, %v, want fresh hw entry", info, ok)
+	}
+	if _, ok := d.cachedAuxInfo(2); ok {
+		t.Errorf("cachedAuxInfo(2) = ok, want expired entry to miss")
+	}
+	if _, ok := d.cachedAuxInfo(3); ok {
+		t.Errorf("cachedAuxInfo(3) = ok, want unknown server to miss")
+	}
+}
+
+func TestRobotDiscoveryFetchAuxInfoLimitsConcurrency(t *testing.T) {
+	const (
+		auxConcurrency = 2
+		numServers     = 6
+	)
+
+	var (
+		mtx       sync.Mutex
+		current   int
+		maxActive int
+	)
+
+	client := &http.Client{
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			mtx.Lock()
+			current++
+			if current > maxActive {
+				maxActive = current
+			}
+			mtx.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mtx.Lock()
+			current--
+			mtx.Unlock()
+
+			return jsonResponse("{}"), nil
+		}),
+	}
+
+	d := &robotDiscovery{
+		logger:         log.NewNopLogger(),
+		endpoint:       "http://robot.invalid",
+		auxConcurrency: auxConcurrency,
+		auxCache:       make(map[int]robotAuxCacheEntry),
+	}
+
+	var serverDocs []string
+	for i := 0; i < numServers; i++ {
+		serverDocs = append(serverDocs, fmt.Sprintf(`{"server": {"server_number": %d}}`, i))
+	}
+	var servers serversList
+	if err := json.Unmarshal([]byte("["+strings.Join(serverDocs, ",")+"]"), &servers); err != nil {
+		t.Fatalf("failed to build test fixture: %v", err)
+	}
+
+	account := robotAccountClient{name: "acct", client: client}
+	d.fetchAuxInfo(context.Background(), account, servers)
+
+	if maxActive > auxConcurrency {
+		t.Errorf("observed %d concurrent aux requests, want at most %d", maxActive, auxConcurrency)
+	}
+}
+
+func TestRobotDiscoveryRefreshMergesAndDedupsAccounts(t *testing.T) {
+	newAccount := func(name, body string) robotAccountClient {
+		return robotAccountClient{
+			name: name,
+			client: &http.Client{
+				Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+					if strings.HasSuffix(r.URL.Path, "/server") {
+						return jsonResponse(body), nil
+					}
+					return jsonResponse("{}"), nil
+				}),
+			},
+		}
+	}
+
+	accountA := newAccount("acct-a", `[
+		{"server": {"server_number": 1, "server_ip": "10.0.0.1", "server_name": "a1", "dc": "fsn1-dc1"}},
+		{"server": {"server_number": 2, "server_ip": "10.0.0.2", "server_name": "a2", "dc": "fsn1-dc1"}}
+	]`)
+	accountB := newAccount("acct-b", `[
+		{"server": {"server_number": 2, "server_ip": "10.0.0.20", "server_name": "b2", "dc": "hel1-dc1"}},
+		{"server": {"server_number": 3, "server_ip": "10.0.0.3", "server_name": "b3", "dc": "hel1-dc1"}}
+	]`)
+
+	d := &robotDiscovery{
+		logger:         log.NewNopLogger(),
+		endpoint:       "http://robot.invalid",
+		accounts:       []robotAccountClient{accountA, accountB},
+		auxConcurrency: defaultRobotAuxConcurrency,
+		auxCache:       make(map[int]robotAuxCacheEntry),
+	}
+
+	groups, err := d.refresh(context.Background())
+	if err != nil {
+		t.Fatalf("refresh() returned error: %v", err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("refresh() returned %d groups, want 1", len(groups))
+	}
+
+	targets := groups[0].Targets
+	if len(targets) != 3 {
+		t.Fatalf("refresh() merged %d targets, want 3 (deduped by server number)", len(targets))
+	}
+
+	seenServerIDs := make(map[string]bool)
+	for _, labels := range targets {
+		id := string(labels[hetznerLabelServerID])
+		seenServerIDs[id] = true
+		if id == "2" {
+			account := string(labels[hetznerLabelRobotAccount])
+			if account != "acct-a" && account != "acct-b" {
+				t.Errorf("server 2 account label = %q, want acct-a or acct-b", account)
+			}
+		}
+	}
+	for _, want := range []string{"1", "2", "3"} {
+		if !seenServerIDs[want] {
+			t.Errorf("missing merged server id %q in %v", want, seenServerIDs)
+		}
+	}
+}